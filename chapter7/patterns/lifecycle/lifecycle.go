@@ -0,0 +1,130 @@
+// Package lifecycle unifies the ad-hoc shutdown logic spread across
+// runner.Runner, pool.Pool, and work.Pool into a single coordinated
+// sequence, with one shared subscription to OS interrupt signals.
+// lifecycle 包将分散在 runner.Runner、pool.Pool
+// 和 work.Pool 中各自为政的关闭逻辑，
+// 统一成一个协调一致的流程，
+// 并共用同一个操作系统中断信号订阅
+package lifecycle
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Component is implemented by anything a Manager can shut down in
+// coordination with the rest of the registered components.
+// Component 接口由任何可以被 Manager
+// 协调关闭的对象实现
+type Component interface {
+	Shutdown(ctx context.Context) error
+}
+
+// Manager subscribes once to os.Interrupt and syscall.SIGTERM and, on
+// receiving either, cancels its root Context and shuts down every
+// registered Component in reverse registration order, bounded by a
+// grace period.
+// Manager 只订阅一次 os.Interrupt 和
+// syscall.SIGTERM，收到信号后会取消其
+// 根 Context，并按注册顺序的逆序关闭每个
+// 已注册的 Component，整个过程受一个
+// 宽限期限制
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	grace  time.Duration
+	sig    chan os.Signal
+	once   sync.Once
+
+	m     sync.Mutex
+	comps []Component
+}
+
+// New creates a Manager whose shutdown sequence is bounded by grace.
+// New 创建一个 Manager，其关闭过程
+// 受 grace 时长限制
+func New(grace time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		ctx:    ctx,
+		cancel: cancel,
+		grace:  grace,
+		sig:    make(chan os.Signal, 1),
+	}
+
+	signal.Notify(m.sig, os.Interrupt, syscall.SIGTERM)
+	go m.watch()
+
+	return m
+}
+
+// watch waits for the first OS signal and triggers Shutdown. // watch 等待第一个操作系统信号并触发 Shutdown
+func (m *Manager) watch() {
+	if _, ok := <-m.sig; ok {
+		m.Shutdown()
+	}
+}
+
+// Context returns the root Context that is canceled when a signal // Context 返回根 Context，
+// arrives or Shutdown is called explicitly. Components such as // 它会在信号到达或显式调用 Shutdown 时被取消。
+// runner.Runner.StartCtx use it to learn they should stop. // runner.Runner.StartCtx 等组件用它
+// // 来获知应当停止运行
+func (m *Manager) Context() context.Context {
+	return m.ctx
+}
+
+// Register adds c to the set of components shut down, in reverse // Register 将 c 加入到关闭时要处理的
+// registration order, when the Manager shuts down. // 组件集合中，关闭时按注册顺序的逆序处理
+func (m *Manager) Register(c Component) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.comps = append(m.comps, c)
+}
+
+// Shutdown cancels the root Context and shuts down every registered // Shutdown 取消根 Context，
+// component in reverse registration order, bounded by the Manager's // 并按注册顺序的逆序关闭每个已注册的组件，
+// grace period. Each component's Shutdown runs in its own goroutine // 整个过程受 Manager 的宽限期限制。每个组件的
+// so the Manager enforces the bound itself instead of trusting the // Shutdown 都在自己的 goroutine 中运行，
+// component to honor ctx: once the grace period expires, Shutdown // 这样 Manager 就能自行保证这个时限，
+// moves on to (or returns past) the remaining components even if one // 而不是信任组件会遵守 ctx：一旦宽限期到期，
+// is still hanging, leaving it to finish or be force-closed on its // Shutdown 会继续处理（或跳过）剩下的组件，
+// own. It is safe to call more than once or concurrently with the // 即便某个组件仍然卡住，也会让它自行
+// signal handler; only the first call has any effect. // 完成或被强制关闭。多次或与信号处理
+// // 并发调用是安全的；只有第一次调用会产生效果
+func (m *Manager) Shutdown() {
+	m.once.Do(func() {
+		m.cancel()
+		signal.Stop(m.sig)
+		close(m.sig)
+
+		m.m.Lock()
+		comps := make([]Component, len(m.comps))
+		copy(comps, m.comps)
+		m.m.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), m.grace)
+		defer cancel()
+
+		for i := len(comps) - 1; i >= 0; i-- {
+			c := comps[i]
+
+			errCh := make(chan error, 1)
+			go func() { errCh <- c.Shutdown(ctx) }()
+
+			select {
+			case err := <-errCh:
+				if err != nil {
+					log.Println("lifecycle: component shutdown error:", err)
+				}
+
+			case <-ctx.Done():
+				log.Println("lifecycle: component shutdown timed out, moving on")
+			}
+		}
+	})
+}
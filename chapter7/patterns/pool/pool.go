@@ -3,10 +3,13 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Pool manages a set of resources that can be shared safely by
@@ -17,17 +20,84 @@ import (
 // 实现 io.Closer 接口
 type Pool struct {
 	m         sync.Mutex
-	resources chan io.Closer
+	resources chan item
 	factory   func() (io.Closer, error)
 	closed    bool
+	stop      chan struct{}
+
+	// maxOpen caps the total number of resources, in-use and idle,
+	// the pool will ever hand out. Zero means unlimited.
+	// maxOpen 限制资源总数（使用中加空闲），
+	// 为 0 表示不限制
+	maxOpen int32
+
+	// open tracks the current number of outstanding resources.
+	// open 记录当前的资源总数
+	open int32
+
+	// validator, when set, is called on Acquire to discard stale or
+	// broken resources and transparently replace them.
+	// validator 在 Acquire 时被调用，用来发现
+	// 失效或损坏的资源，并透明地替换它们
+	validator func(io.Closer) bool
+}
+
+// item wraps a pooled resource along with the time it was released,
+// so the reaper can tell how long it has been sitting idle.
+// item 包装一个被池化的资源，并记录它被
+// 释放的时间，以便回收协程判断其空闲了多久
+type item struct {
+	resource io.Closer
+	idleAt   time.Time
 }
 
+// Config carries the optional limits and hooks used to tune a Pool
+// beyond the defaults New provides.
+// Config 携带用来调整 Pool 的可选上限与钩子，
+// 这些在 New 的默认值之外生效
+type Config struct {
+	// MaxOpen caps the total number of resources, in-use and idle,
+	// the pool will ever hand out. A value <= 0 means unlimited.
+	// MaxOpen 限制资源总数（使用中加空闲），
+	// 小于等于 0 表示不限制
+	MaxOpen int
+
+	// Validator is called on Acquire and AcquireContext to detect
+	// stale or broken resources; when it returns false the resource
+	// is closed and a replacement is created in its place.
+	// Validator 在 Acquire 和 AcquireContext 时被调用，
+	// 用来发现失效或损坏的资源；返回 false 时
+	// 该资源会被关闭，并创建一个替代资源
+	Validator func(io.Closer) bool
+
+	// IdleTimeout, when greater than zero, causes resources that have
+	// sat idle longer than this duration to be closed by a background
+	// reaper goroutine.
+	// IdleTimeout 大于 0 时，闲置超过该时长的
+	// 资源会被后台回收协程关闭
+	IdleTimeout time.Duration
+}
+
+// reapInterval is how often the idle reaper goroutine sweeps the
+// pool looking for resources that have been idle too long.
+// reapInterval 是回收协程扫描池、寻找闲置过久
+// 资源的间隔
+const reapInterval = time.Second
+
 // ErrPoolClosed is returned when an Acquire returns on a
 // closed pool.
 // ErrPoolClosed 表示请求（Acquire）了一个
 // 已经关闭的池
 var ErrPoolClosed = errors.New("Pool has been closed.")
 
+// ErrPoolExhausted is returned by Acquire when MaxOpen has been
+// reached and no idle resource is available. Callers that want to
+// wait for one should use AcquireContext instead.
+// ErrPoolExhausted 表示已经达到 MaxOpen 上限且
+// 没有空闲资源可用。想要等待资源的调用者
+// 应该使用 AcquireContext
+var ErrPoolExhausted = errors.New("Pool is exhausted.")
+
 // New creates a pool that manages resources. A pool requires a
 // function that can allocate a new resource and the size of
 // the pool.
@@ -35,14 +105,34 @@ var ErrPoolClosed = errors.New("Pool has been closed.")
 // 这个池需要一个可以分配新资源的函数，
 // 并规定池的大小
 func New(fn func() (io.Closer, error), size uint) (*Pool, error) {
+	return NewWithConfig(fn, size, Config{})
+}
+
+// NewWithConfig creates a pool the same way New does but also applies
+// the limits and hooks carried by cfg, such as a MaxOpen cap, a
+// Validator, and an idle-timeout reaper.
+// NewWithConfig 和 New 一样创建一个池，
+// 但同时应用 cfg 携带的限制与钩子，
+// 例如 MaxOpen 上限、Validator 以及
+// 闲置超时回收
+func NewWithConfig(fn func() (io.Closer, error), size uint, cfg Config) (*Pool, error) {
 	if size <= 0 {
 		return nil, errors.New("Size value too small.")
 	}
 
-	return &Pool{
+	p := &Pool{
 		factory:   fn,
-		resources: make(chan io.Closer, size),
-	}, nil
+		resources: make(chan item, size),
+		maxOpen:   int32(cfg.MaxOpen),
+		validator: cfg.Validator,
+		stop:      make(chan struct{}),
+	}
+
+	if cfg.IdleTimeout > 0 {
+		go p.reap(cfg.IdleTimeout)
+	}
+
+	return p, nil
 }
 
 // Acquire retrieves a resource	from the pool.
@@ -51,19 +141,119 @@ func (p *Pool) Acquire() (io.Closer, error) {
 	select {
 	// Check for a free resource.
 	// 检查是否有空闲的资源
-	case r, ok := <-p.resources:
-		log.Println("Acquire:", "Shared Resource")
+	case it, ok := <-p.resources:
 		if !ok {
 			return nil, ErrPoolClosed
 		}
-		return r, nil
+		log.Println("Acquire:", "Shared Resource")
+		return p.validate(it)
 
 	// Provide a new resource since there are none available.
 	// 因为没有空闲资源可用，所以提供一个新资源
 	default:
+		if !p.reserve() {
+			return nil, ErrPoolExhausted
+		}
 		log.Println("Acquire:", "New Resource")
-		return p.factory()
+		r, err := p.factory()
+		if err != nil {
+			atomic.AddInt32(&p.open, -1)
+			return nil, err
+		}
+		return r, nil
+	}
+}
+
+// AcquireContext retrieves a resource from the pool, blocking until
+// one becomes free, a new one can be created under the MaxOpen cap,
+// or ctx is done, whichever happens first.
+// AcquireContext 从池中获取一个资源，
+// 在有空闲资源、可以在 MaxOpen 上限内创建新资源，
+// 或 ctx 结束之前阻塞等待，以先发生者为准
+func (p *Pool) AcquireContext(ctx context.Context) (io.Closer, error) {
+	for {
+		select {
+		case it, ok := <-p.resources:
+			if !ok {
+				return nil, ErrPoolClosed
+			}
+			log.Println("AcquireContext:", "Shared Resource")
+			return p.validate(it)
+
+		default:
+		}
+
+		if p.reserve() {
+			log.Println("AcquireContext:", "New Resource")
+			r, err := p.factory()
+			if err != nil {
+				atomic.AddInt32(&p.open, -1)
+				return nil, err
+			}
+			return r, nil
+		}
+
+		select {
+		case it, ok := <-p.resources:
+			if !ok {
+				return nil, ErrPoolClosed
+			}
+			log.Println("AcquireContext:", "Shared Resource")
+			return p.validate(it)
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// reserve claims a slot against maxOpen, returning false if the cap
+// is already reached. A maxOpen of zero or less means unlimited.
+// reserve 在 maxOpen 限制下占用一个名额，
+// 如果已经达到上限则返回 false。
+// maxOpen 小于等于 0 表示不限制
+func (p *Pool) reserve() bool {
+	if p.maxOpen <= 0 {
+		atomic.AddInt32(&p.open, 1)
+		return true
+	}
+
+	for {
+		cur := atomic.LoadInt32(&p.open)
+		if cur >= p.maxOpen {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&p.open, cur, cur+1) {
+			return true
+		}
+	}
+}
+
+// validate runs the configured Validator against an idle resource,
+// discarding and transparently replacing it if it is no longer
+// healthy.
+// validate 对一个空闲资源运行已配置的 Validator，
+// 如果该资源已经不再健康，就丢弃它并
+// 透明地替换一个新资源
+func (p *Pool) validate(it item) (io.Closer, error) {
+	if p.validator == nil || p.validator(it.resource) {
+		return it.resource, nil
+	}
+
+	log.Println("Acquire:", "Discarding Stale Resource")
+	it.resource.Close()
+	atomic.AddInt32(&p.open, -1)
+
+	if !p.reserve() {
+		return nil, ErrPoolExhausted
+	}
+
+	r, err := p.factory()
+	if err != nil {
+		atomic.AddInt32(&p.open, -1)
+		return nil, err
 	}
+	return r, nil
 }
 
 // Release places a new resource onto the pool.
@@ -78,13 +268,14 @@ func (p *Pool) Release(r io.Closer) {
 	// 如果池已经被关闭，销毁这个资源
 	if p.closed {
 		r.Close()
+		atomic.AddInt32(&p.open, -1)
 		return
 	}
 
 	select {
 	// Attempt to place the new resource on the queue.
 	// 试图将这个资源放入队列
-	case p.resources <- r:
+	case p.resources <- item{resource: r, idleAt: time.Now()}:
 		log.Println("Release:", "In Queue")
 
 	// If the queue is already at cap we close the resource.
@@ -92,6 +283,37 @@ func (p *Pool) Release(r io.Closer) {
 	default:
 		log.Println("Release:", "Closing")
 		r.Close()
+		atomic.AddInt32(&p.open, -1)
+	}
+}
+
+// Shutdown implements lifecycle.Component by closing the pool in the
+// background and returning as soon as that finishes or ctx is done,
+// whichever happens first. A slow-closing resource (a stuck DB or
+// network connection, say) can make Close take longer than ctx
+// allows; Shutdown still returns ctx.Err() promptly in that case,
+// leaving Close to finish closing resources on its own.
+// Shutdown 通过在后台关闭资源池来实现
+// lifecycle.Component，并在关闭完成或 ctx
+// 结束（以先发生者为准）后立即返回。一个
+// 迟迟无法关闭的资源（比如卡住的数据库或
+// 网络连接）可能会让 Close 耗时超过 ctx
+// 允许的时长；这种情况下 Shutdown 仍会
+// 及时返回 ctx.Err()，而 Close 会在后台
+// 自行完成资源的关闭
+func (p *Pool) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -113,6 +335,10 @@ func (p *Pool) Close() {
 	// 将池关闭
 	p.closed = true
 
+	// Stop the idle reaper, if one is running.
+	// 停止闲置回收协程（如果正在运行）
+	close(p.stop)
+
 	// Close the channel before we drain the channel of its
 	// resources. If we don't do this, we will have a deadlock.
 	// 在清空通道里的资源之前，将通道关闭
@@ -121,7 +347,74 @@ func (p *Pool) Close() {
 
 	// Close the resources
 	// 关闭资源
-	for r := range p.resources {
-		r.Close()
+	for it := range p.resources {
+		it.resource.Close()
+	}
+}
+
+// reap periodically closes idle resources that have been sitting in
+// the pool longer than timeout, shrinking the pool back down once
+// load subsides.
+// reap 定期关闭那些在池中闲置时间
+// 超过 timeout 的资源，在负载降低后
+// 让池收缩回去
+func (p *Pool) reap(timeout time.Duration) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+
+		case <-ticker.C:
+			p.reapOnce(timeout)
+		}
+	}
+}
+
+// reapOnce drains the idle queue, closing anything that has been
+// idle too long and putting everything else back. It holds the same
+// lock Close uses around p.resources, so a Close racing with a
+// reapOnce that is about to put a still-healthy resource back can
+// never observe the channel close out from under it.
+// reapOnce 清空一遍空闲队列，关闭闲置过久的资源，
+// 并把其余资源放回去。它持有和 Close 相同的锁来
+// 保护 p.resources，因此当 reapOnce 正要把一个
+// 仍然健康的资源放回去时，不会与并发的 Close
+// 发生竞争，看到通道在自己眼皮底下被关闭
+func (p *Pool) reapOnce(timeout time.Duration) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.closed {
+		return
+	}
+
+	n := len(p.resources)
+	for i := 0; i < n; i++ {
+		select {
+		case it, ok := <-p.resources:
+			if !ok {
+				return
+			}
+
+			if time.Since(it.idleAt) >= timeout {
+				log.Println("Reap:", "Closing Idle Resource")
+				it.resource.Close()
+				atomic.AddInt32(&p.open, -1)
+				continue
+			}
+
+			select {
+			case p.resources <- it:
+			default:
+				it.resource.Close()
+				atomic.AddInt32(&p.open, -1)
+			}
+
+		default:
+			return
+		}
 	}
 }
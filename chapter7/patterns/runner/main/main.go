@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"time"
@@ -22,7 +23,7 @@ func main() {
 	r := runner.New(timeout)
 
 	// Add the tasks to be run. // 加入要执行的任务
-	r.Add(createTask(), createTask(), createTask())
+	r.Add(createTask(2, 0), createTask(1, 0), createTask(3, 1))
 
 	// Run the tasks and handle the result. // 执行任务并处理结果
 	if err := r.Start(); err != nil {
@@ -33,17 +34,31 @@ func main() {
 		case runner.ErrInterrupt:
 			log.Println("Terminating due to interrupt.")
 			os.Exit(2)
+		default:
+			log.Println("Terminating due to task error:", err)
+			os.Exit(3)
 		}
 	}
 
 	log.Println("Process ended.")
 }
 
-// createTask returns an example task that sleeps for the specified // createTask 返回一个根据 id
-// number of seconds based on the id.  // 休眠指定秒数的示例任务
-func createTask() func(int) {
-	return func(id int) {
-		log.Printf("Processor - Task #%d.", id)
-		time.Sleep(time.Duration(id) * time.Second)
+// createTask returns an example task that sleeps for the specified // createTask 返回一个根据 priority
+// number of seconds based on its priority and retries up to maxRetries // 休眠指定秒数、最多重试 maxRetries 次
+// times if it is interrupted before finishing. // 的示例任务
+func createTask(priority, maxRetries int) runner.Task {
+	return runner.Task{
+		Priority:   priority,
+		MaxRetries: maxRetries,
+		Backoff:    time.Second,
+		Run: func(ctx context.Context, id int) error {
+			log.Printf("Processor - Task #%d.", id)
+			select {
+			case <-time.After(time.Duration(priority) * time.Second):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
 	}
 }
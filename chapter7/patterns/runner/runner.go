@@ -3,9 +3,12 @@ package runner
 // Example is provided with help by Gabriel Aszalos. // Gabriel Aszalos 协助完成了这个示例
 // Package runner manages the running and lifetime of a process. // runner 包管理处理任务的运行和生命周期
 import (
+	"container/heap"
+	"context"
 	"errors"
 	"os"
 	"os/signal"
+	"strings"
 	"time"
 )
 
@@ -22,9 +25,78 @@ type Runner struct {
 	// timeout reports that time has run out. // timeout 报告处理任务已经超时.
 	timeout <-chan time.Time
 
-	// tasks holds a set of functions that are executed // tasks 持有一组以索引顺序依次执行的
-	// synchronously in index order.
-	tasks []func(int)
+	// deadline is the point in time the overall run must finish by, // deadline 是整个运行必须完成的时间点，
+	// used to derive the per-task timeout from the remaining budget. // 用来根据剩余的时间预算推算每个任务的超时时间.
+	deadline time.Time
+
+	// queue holds the pending tasks ordered by priority, with FIFO // queue 持有按优先级排序的待执行任务，
+	// order among tasks of equal priority. // 优先级相同时按先进先出排序.
+	queue taskQueue
+
+	// seq assigns each added task a strictly increasing sequence // seq 为每个加入的任务分配一个严格递增的
+	// number, used as the FIFO tiebreaker; the task's id is that // 序号，用作 FIFO 的判定依据；任务的 id 是
+	// number minus one, so ids start at 0. // 该序号减一，因此 id 从 0 开始.
+	seq int
+}
+
+// Task describes a unit of work the Runner can schedule. Tasks with // Task 描述了 Runner 可以调度的一个工作单元。
+// a higher Priority run first; within the same Priority they run in // Priority 更高的任务先执行；同一 Priority 下
+// the order they were added. A Task that returns an error is retried // 按加入顺序执行。返回错误的任务会按
+// up to MaxRetries times, waiting Backoff (doubled on each attempt) // MaxRetries 重试，每次重试前等待 Backoff
+// between attempts. // （每次尝试后翻倍）.
+type Task struct {
+	Priority   int
+	MaxRetries int
+	Backoff    time.Duration
+	Run        func(ctx context.Context, id int) error
+}
+
+// taskItem wraps a Task with the scheduling state the heap and retry // taskItem 包装了一个 Task，附加堆和重试逻辑
+// logic need to track. // 所需要的调度状态.
+type taskItem struct {
+	task    Task
+	id      int
+	seq     int
+	attempt int
+}
+
+// taskQueue is a container/heap ordered by Priority (higher first), // taskQueue 是一个按 Priority 排序（更高者优先）
+// falling back to FIFO order for equal priorities. // 的堆，优先级相同时按 FIFO 排序.
+type taskQueue []*taskItem
+
+func (q taskQueue) Len() int { return len(q) }
+
+func (q taskQueue) Less(i, j int) bool {
+	if q[i].task.Priority != q[j].task.Priority {
+		return q[i].task.Priority > q[j].task.Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q taskQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *taskQueue) Push(x interface{}) { *q = append(*q, x.(*taskItem)) }
+
+func (q *taskQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	it := old[n-1]
+	*q = old[:n-1]
+	return it
+}
+
+// TaskErrors aggregates the errors returned by tasks that exhausted // TaskErrors 汇总了那些重试次数用尽后
+// their retries. // 仍然失败的任务所返回的错误.
+type TaskErrors []error
+
+// Error implements the error interface by joining the individual // Error 实现了 error 接口，将每个任务的
+// task errors. // 错误信息拼接在一起.
+func (e TaskErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
 }
 
 // ErrTimeout is returned when a value is received on the timeout channel. // ErrTimeout 会在任务执行超时时返回
@@ -39,23 +111,43 @@ func New(d time.Duration) *Runner {
 		interrupt: make(chan os.Signal, 1),
 		complete:  make(chan error),
 		timeout:   time.After(d),
+		deadline:  time.Now().Add(d),
 	}
 }
 
-// Add attaches tasks to the Runner. A task is a function that  // Add 将一个任务附加到 Runner 上。这个任务是一个
-// takes an int ID. // 接收一个 int 类型的 ID 作为参数的函数
-func (r *Runner) Add(tasks ...func(int)) {
-	r.tasks = append(r.tasks, tasks...)
+// Add attaches tasks to the Runner. Tasks are scheduled by Priority // Add 将任务附加到 Runner 上。任务会按
+// (FIFO among equal priorities), not by the order Add is called. // Priority 调度（优先级相同时按 FIFO），
+// // 而不是按调用 Add 的顺序.
+func (r *Runner) Add(tasks ...Task) {
+	for _, t := range tasks {
+		r.seq++
+		heap.Push(&r.queue, &taskItem{task: t, id: r.seq - 1, seq: r.seq})
+	}
 }
 
-// Start runs all tasks and monitors channel events. // Start 执行所有任务，并监视通道事件
+// Start runs all tasks and monitors channel events, subscribing to // Start 执行所有任务并监视通道事件，
+// OS interrupts itself. // 自行订阅操作系统中断信号
 func (r *Runner) Start() error {
 	// We want to receive all interrupt based signals. // 我们希望接收所有中断信号
 	signal.Notify(r.interrupt, os.Interrupt)
 
-	// Run the different tasks on a different goroutine. // 用不同的 goroutine 执行不同的任务
+	return r.startCtx(context.Background())
+}
+
+// StartCtx runs all tasks the same way Start does, but treats ctx // StartCtx 和 Start 一样执行所有任务，
+// being canceled as an additional interrupt source instead of calling // 但把 ctx 被取消当作额外的中断来源，
+// signal.Notify itself. This lets multiple Runners share a single // 而不是自行调用 signal.Notify。
+// signal subscription, such as one owned by a lifecycle.Manager. // 这样多个 Runner 就可以共用同一个信号订阅，
+// // 例如由 lifecycle.Manager 持有的那个
+func (r *Runner) StartCtx(ctx context.Context) error {
+	return r.startCtx(ctx)
+}
+
+// startCtx runs the different tasks on a different goroutine and // startCtx 用不同的 goroutine 执行不同的任务，
+// monitors channel events. // 并监视通道事件
+func (r *Runner) startCtx(ctx context.Context) error {
 	go func() {
-		r.complete <- r.run()
+		r.complete <- r.run(ctx)
 	}()
 
 	select {
@@ -69,21 +161,62 @@ func (r *Runner) Start() error {
 	}
 }
 
-// run executes each registered task. // 当任务处理程序运行超时时发出的信号
-func (r *Runner) run() error {
-	for id, task := range r.tasks {
-		// Check for an interrupt signal from the OS. // 检测操作系统的中断信号
-		if r.gotInterrupt() {
+// run pops tasks off the priority queue and executes them, retrying // run 从优先级队列中取出任务并执行，
+// failures with backoff until MaxRetries is exhausted. // 失败的任务会按 Backoff 重试，直到 MaxRetries 用尽.
+func (r *Runner) run(ctx context.Context) error {
+	var errs TaskErrors
+
+	for r.queue.Len() > 0 {
+		// Check for an interrupt signal from the OS or a canceled ctx. // 检测操作系统的中断信号或被取消的 ctx
+		if r.gotInterrupt() || ctx.Err() != nil {
 			return ErrInterrupt
 		}
 
-		// Execute the registered task. // 执行已注册的任务
-		task(id)
+		it := heap.Pop(&r.queue).(*taskItem)
+
+		taskCtx, cancel := context.WithTimeout(ctx, r.remaining())
+		err := it.task.Run(taskCtx, it.id)
+		cancel()
+
+		if err == nil {
+			continue
+		}
+
+		if it.attempt < it.task.MaxRetries {
+			it.attempt++
+			time.Sleep(backoff(it.task.Backoff, it.attempt))
+			heap.Push(&r.queue, it)
+			continue
+		}
+
+		errs = append(errs, err)
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
 	return nil
 }
 
+// remaining reports how much of the overall timeout budget is left, // remaining 报告整体超时预算还剩多少，
+// used as the per-task context timeout. // 用作每个任务的 context 超时时间.
+func (r *Runner) remaining() time.Duration {
+	d := time.Until(r.deadline)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// backoff returns base doubled attempt-1 times, the exponential // backoff 返回 base 翻倍 attempt-1 次后的结果，
+// delay to wait before retrying a failed task. // 即重试失败任务前需要等待的指数退避时间.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	return base << uint(attempt-1)
+}
+
 // gotInterrupt verifies if the interrupt signal has been issued. // gotInterrupt 验证是否接收到了中断信号
 func (r *Runner) gotInterrupt() bool {
 	select {
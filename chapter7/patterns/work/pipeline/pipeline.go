@@ -0,0 +1,185 @@
+// Package pipeline composes work.Pool instances into typed,
+// multi-stage streaming pipelines using the generator + multiplexer
+// pattern: each stage runs its own pool of producer goroutines that
+// read from an input channel and feed a single merged output channel.
+// pipeline 包使用生成器加多路复用器模式，
+// 将 work.Pool 组合成带类型的多阶段流水线：
+// 每个阶段拥有自己的一组生产者 goroutine，
+// 从输入通道读取数据，并汇总到一个合并后的输出通道
+package pipeline
+
+import (
+	"context"
+	"sync"
+
+	"github.com/goinaction/code/chapter7/patterns/work"
+)
+
+// Stage transforms a single input value of type I into an output
+// value of type O. Run and New use Stage to describe the work each
+// pipeline stage performs.
+// Stage 将一个类型为 I 的输入值转换为
+// 一个类型为 O 的输出值。Run 和 New
+// 使用 Stage 描述每个流水线阶段要完成的工作
+type Stage[I, O any] func(ctx context.Context, in I) (O, error)
+
+// stageWorker adapts a single Stage invocation to the work.Worker
+// interface so it can be submitted to a work.Pool.
+// stageWorker 将单次 Stage 调用适配成
+// work.Worker 接口，以便提交给 work.Pool
+type stageWorker[I, O any] struct {
+	ctx   context.Context
+	in    I
+	stage Stage[I, O]
+	out   chan<- O
+	errs  chan<- error
+}
+
+// Task runs the wrapped stage and forwards its result, satisfying // Task 执行被包装的阶段并转发结果，
+// work.Worker. // 以满足 work.Worker 接口
+func (w stageWorker[I, O]) Task() {
+	if w.ctx.Err() != nil {
+		return
+	}
+
+	o, err := w.stage(w.ctx, w.in)
+	if err != nil {
+		select {
+		case w.errs <- err:
+		default:
+		}
+		return
+	}
+
+	select {
+	case w.out <- o:
+	case <-w.ctx.Done():
+	}
+}
+
+// Run executes stage over every value read from in using workers // Run 使用 workers 个 goroutine
+// goroutines backed by a work.Pool, and returns the merged output // 在 work.Pool 支撑下，对从 in 读取的每个值
+// channel along with a buffered channel that carries the first error // 执行 stage，返回合并后的输出通道，
+// encountered. Both channels are closed once in is drained or ctx is // 以及一个携带首个遇到错误的带缓冲通道。
+// canceled (whichever happens first) and every in-flight task has // 当 in 耗尽或 ctx 被取消（以先发生者为准），
+// finished. // 并且所有运行中的任务都结束后，两个通道才会被关闭
+func Run[I, O any](ctx context.Context, in <-chan I, stage Stage[I, O], workers, bufSize int) (<-chan O, <-chan error) {
+	out := make(chan O, bufSize)
+	errs := make(chan error, 1)
+	pool := work.New(workers)
+
+	go func() {
+		var wg sync.WaitGroup
+
+	drain:
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					break drain
+				}
+
+				wg.Add(1)
+				pool.Run(stopOnDone{
+					Worker: stageWorker[I, O]{ctx: ctx, in: v, stage: stage, out: out, errs: errs},
+					done:   wg.Done,
+				})
+
+			case <-ctx.Done():
+				break drain
+			}
+		}
+
+		pool.Shutdown(context.Background())
+		wg.Wait()
+		close(out)
+		close(errs)
+	}()
+
+	return out, errs
+}
+
+// stopOnDone wraps a work.Worker so the pipeline's WaitGroup is // stopOnDone 包装一个 work.Worker，
+// always released after Task runs, even if the stage panics. // 确保即使 Task 发生 panic，流水线的
+// // WaitGroup 也总能被释放
+type stopOnDone struct {
+	work.Worker
+	done func()
+}
+
+func (w stopOnDone) Task() {
+	defer w.done()
+	w.Worker.Task()
+}
+
+// Pipeline chains a sequence of same-typed Stages built with New, // Pipeline 串联了一组由 New 构建的
+// giving callers a single output and error channel for the whole // 同类型 Stage，为整条链提供统一的
+// chain instead of one pair per stage. // 输出和错误通道，而不必为每个阶段分别处理
+type Pipeline[T any] struct {
+	out    <-chan T
+	errs   <-chan error
+	cancel context.CancelFunc
+}
+
+// New wires stages together into a Pipeline, feeding the output of // New 将多个 stage 串联成一个 Pipeline，
+// each stage into the next with the given per-stage buffer size and // 用给定的缓冲区大小和每阶段工作协程数，
+// worker count. The returned Pipeline owns ctx's cancellation; // 把前一阶段的输出接入下一阶段。
+// calling Close stops every stage and drains their goroutines. // 返回的 Pipeline 持有 ctx 的取消权；调用
+// // Close 会停止每个阶段并清空其 goroutine
+func New[T any](ctx context.Context, in <-chan T, bufSize, workers int, stages ...Stage[T, T]) *Pipeline[T] {
+	ctx, cancel := context.WithCancel(ctx)
+
+	errChs := make([]<-chan error, 0, len(stages))
+	cur := in
+	for _, stage := range stages {
+		var errs <-chan error
+		cur, errs = Run(ctx, cur, stage, workers, bufSize)
+		errChs = append(errChs, errs)
+	}
+
+	return &Pipeline[T]{
+		out:    cur,
+		errs:   Merge(errChs...),
+		cancel: cancel,
+	}
+}
+
+// Out returns the channel of values produced by the final stage. // Out 返回最后一个阶段产生的值的通道
+func (p *Pipeline[T]) Out() <-chan T { return p.out }
+
+// Errors surfaces the first error raised by each stage, so it carries // Errors 暴露每个阶段产生的首个错误，
+// at most one error per stage. It is closed once every stage has // 因此每个阶段最多携带一个错误。
+// finished draining. // 在所有阶段排空后被关闭
+func (p *Pipeline[T]) Errors() <-chan error { return p.errs }
+
+// Close cancels the pipeline's context, stopping every stage and // Close 取消流水线的 context，
+// letting their goroutines drain without leaking. // 停止每个阶段，并让其 goroutine 干净地退出
+func (p *Pipeline[T]) Close() {
+	p.cancel()
+}
+
+// Merge fan-in's multiple channels of the same type into a single // Merge 将多个同类型的通道汇合成一个，
+// channel, spawning one forwarding goroutine per input and closing // 为每个输入通道启动一个转发 goroutine，
+// the merged channel once every input has drained. // 并在所有输入耗尽后关闭合并后的通道
+func Merge[T any](chs ...<-chan T) <-chan T {
+	out := make(chan T)
+
+	var wg sync.WaitGroup
+	wg.Add(len(chs))
+
+	for _, ch := range chs {
+		go func(ch <-chan T) {
+			defer wg.Done()
+			for v := range ch {
+				out <- v
+			}
+		}(ch)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
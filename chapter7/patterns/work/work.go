@@ -4,7 +4,13 @@
 // work 包管理一个 goroutine 池来完成工作
 package work
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // Worker must be implemented by types that want to use
 // the work pool.
@@ -19,28 +25,130 @@ type Worker interface {
 // Pool 提供一个 goroutine 池， 这个池可以完成
 // 任何已提交的 Worker 任务
 type Pool struct {
-	work chan Worker
-	wg   sync.WaitGroup
+	work    chan Worker
+	stop    chan struct{}
+	stopAck chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+
+	// workers tracks the number of goroutines currently running,
+	// grown and shrunk by Resize.
+	// workers 记录当前正在运行的 goroutine 数量，
+	// 由 Resize 增加或减少
+	workers int32
+
+	// target is the worker count Resize last asked for. resizeLoop is
+	// the sole goroutine that acts on it, so concurrent Resize calls
+	// can never over-shrink the pool.
+	// target 是 Resize 最近一次请求的 worker 数量。
+	// resizeLoop 是唯一根据它采取行动的 goroutine，
+	// 因此并发的 Resize 调用不会导致池被过度收缩
+	target int32
+
+	// resize wakes resizeLoop when target changes.
+	// resize 在 target 改变时唤醒 resizeLoop
+	resize chan struct{}
+
+	// idle tracks how many of those goroutines are waiting for work
+	// right now.
+	// idle 记录这些 goroutine 中当前有多少
+	// 正在等待工作
+	idle int32
+
+	// completed and totalTaskNs accumulate the stats reported by
+	// Stats.
+	// completed 和 totalTaskNs 累积了
+	// Stats 所报告的统计数据
+	completed   uint64
+	totalTaskNs int64
 }
 
+// Stats reports a snapshot of a Pool's current load.
+// Stats 报告一个 Pool 当前负载的快照
+type Stats struct {
+	Active          int
+	Idle            int
+	Queued          int
+	Completed       uint64
+	AvgTaskDuration time.Duration
+}
+
+// ErrRunTimeout is returned by RunWithTimeout when the work cannot be
+// queued within the given duration.
+// ErrRunTimeout 表示 RunWithTimeout 在给定时长内
+// 无法将这项工作放入队列
+var ErrRunTimeout = errors.New("work: timed out submitting work")
+
 // New creates a new work pool.
 // New 创建一个新工作池
 func New(maxGoroutines int) *Pool {
-	p := Pool{
-		work: make(chan Worker),
+	p := &Pool{
+		work:    make(chan Worker, maxGoroutines),
+		stop:    make(chan struct{}),
+		stopAck: make(chan struct{}),
+		done:    make(chan struct{}),
+		resize:  make(chan struct{}, 1),
+		target:  int32(maxGoroutines),
 	}
 
-	p.wg.Add(maxGoroutines)
-	for i := 0; i < maxGoroutines; i++ {
-		go func() {
-			for w := range p.work {
-				w.Task()
-			}
-			p.wg.Done()
-		}()
+	p.grow(maxGoroutines)
+	go p.resizeLoop()
+
+	return p
+}
+
+// grow starts n additional worker goroutines.
+// grow 启动 n 个新的工作 goroutine
+func (p *Pool) grow(n int) {
+	p.wg.Add(n)
+	for i := 0; i < n; i++ {
+		atomic.AddInt32(&p.workers, 1)
+		go p.worker()
 	}
+}
+
+// worker pulls Worker values off p.work and runs them until p.work is
+// closed or it is told to stop by Resize shrinking the pool. When
+// stopped by Resize it acknowledges its exit on stopAck only after
+// decrementing workers, so resizeLoop can tell exactly when it is
+// safe to re-read the worker count.
+// worker 从 p.work 中取出 Worker 并执行，
+// 直到 p.work 被关闭，或 Resize 收缩池时
+// 要求它停止。当被 Resize 要求停止时，
+// 它只在递减 workers 之后才在 stopAck 上
+// 确认自己已经退出，这样 resizeLoop 就能
+// 准确知道何时可以安全地重新读取 worker 数量
+func (p *Pool) worker() {
+	defer p.wg.Done()
 
-	return &p
+	for {
+		atomic.AddInt32(&p.idle, 1)
+
+		select {
+		case w, ok := <-p.work:
+			atomic.AddInt32(&p.idle, -1)
+			if !ok {
+				atomic.AddInt32(&p.workers, -1)
+				return
+			}
+
+			start := time.Now()
+			w.Task()
+			atomic.AddInt64(&p.totalTaskNs, int64(time.Since(start)))
+			atomic.AddUint64(&p.completed, 1)
+
+		case <-p.stop:
+			atomic.AddInt32(&p.idle, -1)
+			atomic.AddInt32(&p.workers, -1)
+			select {
+			case p.stopAck <- struct{}{}:
+			case <-p.done:
+			}
+			return
+		}
+	}
 }
 
 // Run submits work to the pool.
@@ -49,9 +157,154 @@ func (p *Pool) Run(w Worker) {
 	p.work <- w
 }
 
-// Shutdown waits for all the goroutines to shutdown.
-// Shutdown 等待所有 goroutine 停止工作
-func (p *Pool) Shutdown() {
+// RunWithTimeout submits work to the pool the same way Run does, but
+// gives up and returns ErrRunTimeout if the work cannot be queued
+// within d. The queue holds up to the maxGoroutines given to New
+// pending tasks, so work can be queued while every worker is busy.
+// RunWithTimeout 和 Run 一样提交工作到工作池，
+// 但如果在 d 时间内无法将这项工作放入队列，
+// 就放弃并返回 ErrRunTimeout。队列最多容纳
+// 传给 New 的 maxGoroutines 个待执行任务，
+// 因此即使所有 worker 都在忙，工作也可以入队
+func (p *Pool) RunWithTimeout(w Worker, d time.Duration) error {
+	select {
+	case p.work <- w:
+		return nil
+
+	case <-time.After(d):
+		return ErrRunTimeout
+	}
+}
+
+// Resize grows the pool to n workers by spawning additional
+// goroutines, or shrinks it by telling the surplus goroutines to exit
+// once they finish whatever task they are currently running. Values
+// of n <= 0 are ignored. Resize only records the new target; a single
+// background goroutine (started by New) does the actual growing and
+// shrinking, so repeated or concurrent Resize calls converge on the
+// latest target instead of piling up independent shrink requests.
+// Resize 通过启动额外的 goroutine 将池扩大到 n 个
+// worker，或者让多余的 goroutine 在完成当前
+// 正在执行的任务后退出，从而缩小池。n <= 0 时
+// 不做任何操作。Resize 只记录新的目标值；
+// 真正的扩容和收缩由 New 启动的唯一一个
+// 后台 goroutine 完成，因此重复或并发的
+// Resize 调用会收敛到最新的目标值，
+// 而不会堆积出相互独立的收缩请求
+func (p *Pool) Resize(n int) {
+	if n <= 0 {
+		return
+	}
+
+	atomic.StoreInt32(&p.target, int32(n))
+
+	select {
+	case p.resize <- struct{}{}:
+	default:
+	}
+}
+
+// resizeLoop is the sole goroutine that converges the pool's worker
+// count toward the target Resize last set, so concurrent Resize calls
+// can never send more stop signals than there are workers left to
+// receive them. It computes the shrink amount once per wake-up and
+// waits for each stopped worker's stopAck before sending the next
+// one, rather than racing the live workers counter: the counter isn't
+// guaranteed to reflect a just-stopped worker's exit the instant its
+// stop signal is accepted, only once stopAck is received.
+// resizeLoop 是唯一一个让池的 worker 数量
+// 向 Resize 最近设置的目标收敛的 goroutine，
+// 因此并发的 Resize 调用不会发送出超过剩余
+// worker 数量的停止信号。它在每次被唤醒时
+// 只计算一次需要收缩的数量，并在发送下一个
+// 停止信号前等待每个被停止的 worker 发来
+// stopAck，而不是去竞争那个实时的 workers
+// 计数器：该计数器并不保证在一个停止信号
+// 被接收的瞬间就反映出对应 worker 已经退出，
+// 只有收到 stopAck 才能保证这一点
+func (p *Pool) resizeLoop() {
+	for {
+		select {
+		case <-p.resize:
+		case <-p.done:
+			return
+		}
+
+		cur := atomic.LoadInt32(&p.workers)
+		tgt := atomic.LoadInt32(&p.target)
+
+		if cur < tgt {
+			p.grow(int(tgt - cur))
+			continue
+		}
+
+		for i := int32(0); i < cur-tgt; i++ {
+			select {
+			case p.stop <- struct{}{}:
+			case <-p.done:
+				return
+			}
+
+			select {
+			case <-p.stopAck:
+			case <-p.done:
+				return
+			}
+		}
+	}
+}
+
+// Stats returns a snapshot of the pool's current load.
+// Stats 返回池当前负载的一个快照
+func (p *Pool) Stats() Stats {
+	idle := atomic.LoadInt32(&p.idle)
+	workers := atomic.LoadInt32(&p.workers)
+	completed := atomic.LoadUint64(&p.completed)
+
+	active := workers - idle
+	if active < 0 {
+		active = 0
+	}
+
+	var avg time.Duration
+	if completed > 0 {
+		avg = time.Duration(atomic.LoadInt64(&p.totalTaskNs) / int64(completed))
+	}
+
+	return Stats{
+		Active:          int(active),
+		Idle:            int(idle),
+		Queued:          len(p.work),
+		Completed:       completed,
+		AvgTaskDuration: avg,
+	}
+}
+
+// Shutdown closes the pool and waits for all the goroutines to
+// finish, implementing lifecycle.Component. It returns ctx.Err() if
+// ctx is done before every goroutine has drained; the goroutines are
+// left running in the background in that case, since Go has no way
+// to force-kill one.
+// Shutdown 关闭工作池并等待所有 goroutine 结束，
+// 实现了 lifecycle.Component。如果 ctx 在所有
+// goroutine 排空之前结束，就返回 ctx.Err()；
+// 这种情况下这些 goroutine 会在后台继续运行，
+// 因为 Go 没有办法强制杀死一个 goroutine
+func (p *Pool) Shutdown(ctx context.Context) error {
 	close(p.work)
-	p.wg.Wait()
+	p.closeOnce.Do(func() { close(p.done) })
+
+	drained := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }